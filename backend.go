@@ -0,0 +1,160 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Backend abstracts the key/value coordination service the master
+// election is run against, so that MasterElectionClient does not need to
+// know whether it is talking to Doozer, etcd, Consul or ZooKeeper. All
+// revisions returned and accepted by a Backend must come from a single,
+// per-backend monotonically increasing counter, the same one Rev()
+// reports, so that the compare-and-swap semantics Set and Del rely on
+// are consistent across calls.
+type Backend interface {
+	// Get retrieves the value and revision currently stored at path.
+	// ErrNoEnt is returned if path does not exist.
+	Get(path string) (body []byte, rev int64, err error)
+
+	// Set stores body at path if and only if path has not been changed
+	// since oldRev, and returns the revision of the new value. If path
+	// has moved on, ErrOldRev or ErrTooLate is returned instead.
+	Set(path string, oldRev int64, body []byte) (newRev int64, err error)
+
+	// Del removes path if and only if it has not been changed since
+	// oldRev. If path has moved on, ErrOldRev or ErrTooLate is
+	// returned instead.
+	Del(path string, oldRev int64) error
+
+	// Wait blocks until path changes at a revision at or after
+	// sinceRev and returns that change as an Event.
+	Wait(path string, sinceRev int64) (Event, error)
+
+	// Rev returns the backend's current revision.
+	Rev() (int64, error)
+
+	// List returns the current children of dir, for backends which
+	// support a hierarchical namespace. It is used to implement the
+	// fair candidate queue in candidate.go; entry names are relative
+	// to dir, not full paths.
+	List(dir string) ([]DirEntry, error)
+
+	// CreateCandidate creates a new entry under dir holding body, for
+	// use in the fair candidate queue implemented in candidate.go, and
+	// returns its name (relative to dir) and revision. Names must sort,
+	// in the order List reports them, by creation order -- this is what
+	// gives the queue its FIFO property. Most backends derive the name
+	// from Rev() (see createCandidateByRev); ZooKeeper, which has no
+	// cluster-wide revision counter, instead relies on native
+	// sequential znodes.
+	CreateCandidate(dir string, body []byte) (name string, rev int64, err error)
+}
+
+// createCandidateByRev implements Backend.CreateCandidate for backends
+// whose revisions come from a single, cluster-wide counter: it derives
+// a sortable name from the current revision and creates it with Set's
+// oldRev-0 "must not already exist" semantics, retrying against the
+// next revision on a name collision. doozerBackend, etcdBackend,
+// consulBackend and localBackend all share this implementation.
+func createCandidateByRev(b Backend, dir string, body []byte) (string, int64, error) {
+	var rev, err = b.Rev()
+	if err != nil {
+		return "", 0, err
+	}
+
+	for {
+		var name = fmt.Sprintf("%020d", rev)
+		var createdRev int64
+
+		createdRev, err = b.Set(dir+"/"+name, 0, body)
+		if err == nil {
+			return name, createdRev, nil
+		}
+		if err != ErrOldRev && err != ErrTooLate {
+			return "", 0, err
+		}
+		rev++
+	}
+}
+
+// DirEntry describes one child of a directory listed via Backend.List.
+type DirEntry struct {
+	// Name is the entry's name relative to the directory it was
+	// listed from.
+	Name string
+
+	// Rev is the revision the entry was last changed at.
+	Rev int64
+}
+
+// Event describes a single change to a path as reported by
+// Backend.Wait.
+type Event struct {
+	// Path is the path the change occurred on.
+	Path string
+
+	// Body is the value path was set to. It is empty for deletions.
+	Body []byte
+
+	// Rev is the revision the change occurred at.
+	Rev int64
+
+	// Deleted indicates whether path was removed rather than set.
+	Deleted bool
+}
+
+// IsSet reports whether the event represents a value being written.
+func (ev Event) IsSet() bool {
+	return !ev.Deleted
+}
+
+// IsDel reports whether the event represents a path being removed.
+func (ev Event) IsDel() bool {
+	return ev.Deleted
+}
+
+var (
+	// ErrNoEnt is returned by Backend.Get when the requested path does
+	// not exist.
+	ErrNoEnt = errors.New("masterelection: no such entry")
+
+	// ErrOldRev is returned by Backend.Set and Backend.Del when oldRev
+	// no longer matches the path's current revision.
+	ErrOldRev = errors.New("masterelection: old revision")
+
+	// ErrTooLate is returned by Backend.Set and Backend.Del when the
+	// request arrived after the backend had already moved past oldRev.
+	ErrTooLate = errors.New("masterelection: too late")
+)
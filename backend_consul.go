@@ -0,0 +1,156 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// consulBackend adapts a *api.Client to the Backend interface. Consul's
+// ModifyIndex plays the role Doozer's revision plays elsewhere in this
+// package, and long-polling blocking queries (WaitIndex) stand in for
+// Doozer's Wait.
+type consulBackend struct {
+	client *api.Client
+}
+
+// NewConsulBackend wraps an existing Consul client as a Backend, for use
+// with NewMasterElectionClient.
+func NewConsulBackend(client *api.Client) Backend {
+	return &consulBackend{client: client}
+}
+
+func (b *consulBackend) Get(path string) ([]byte, int64, error) {
+	var pair *api.KVPair
+	var err error
+
+	pair, _, err = b.client.KV().Get(path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if pair == nil {
+		return nil, 0, ErrNoEnt
+	}
+	return pair.Value, int64(pair.ModifyIndex), nil
+}
+
+func (b *consulBackend) Set(path string, oldRev int64, body []byte) (int64, error) {
+	var pair = &api.KVPair{Key: path, Value: body, ModifyIndex: uint64(oldRev)}
+	var ok bool
+	var err error
+
+	ok, _, err = b.client.KV().CAS(pair, nil)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrOldRev
+	}
+
+	pair, _, err = b.client.KV().Get(path, nil)
+	if err != nil {
+		return 0, err
+	}
+	return int64(pair.ModifyIndex), nil
+}
+
+func (b *consulBackend) Del(path string, oldRev int64) error {
+	var pair = &api.KVPair{Key: path, ModifyIndex: uint64(oldRev)}
+	var ok bool
+	var err error
+
+	ok, _, err = b.client.KV().DeleteCAS(pair, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrOldRev
+	}
+	return nil
+}
+
+func (b *consulBackend) Wait(path string, sinceRev int64) (Event, error) {
+	var pair *api.KVPair
+	var meta *api.QueryMeta
+	var err error
+
+	pair, meta, err = b.client.KV().Get(path,
+		&api.QueryOptions{WaitIndex: uint64(sinceRev)})
+	if err != nil {
+		return Event{}, err
+	}
+	if pair == nil {
+		return Event{Path: path, Rev: int64(meta.LastIndex), Deleted: true}, nil
+	}
+	return Event{
+		Path: path,
+		Body: pair.Value,
+		Rev:  int64(pair.ModifyIndex),
+	}, nil
+}
+
+func (b *consulBackend) Rev() (int64, error) {
+	var _, meta, err = b.client.KV().Get("/", nil)
+	if err != nil {
+		return 0, err
+	}
+	return int64(meta.LastIndex), nil
+}
+
+func (b *consulBackend) CreateCandidate(dir string, body []byte) (string, int64, error) {
+	return createCandidateByRev(b, dir, body)
+}
+
+func (b *consulBackend) List(dir string) ([]DirEntry, error) {
+	var pairs api.KVPairs
+	var entries []DirEntry
+	var prefix = dir + "/"
+	var err error
+
+	pairs, _, err = b.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pair := range pairs {
+		var name = strings.TrimPrefix(pair.Key, prefix)
+		if name == "" || strings.Contains(name, "/") {
+			// Skip the directory marker entry itself, and anything
+			// nested deeper than a direct child.
+			continue
+		}
+		entries = append(entries, DirEntry{Name: name, Rev: int64(pair.ModifyIndex)})
+	}
+	return entries, nil
+}
@@ -0,0 +1,156 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"net"
+
+	"github.com/ha/doozer"
+)
+
+// doozerBackend adapts a *doozer.Conn to the Backend interface.
+type doozerBackend struct {
+	conn *doozer.Conn
+}
+
+// NewDoozerBackend wraps an existing Doozer connection as a Backend, for
+// use with NewMasterElectionClient. Most callers which are not migrating
+// other backends in alongside Doozer will prefer the
+// NewDoozerMasterElectionClient shortcut instead.
+func NewDoozerBackend(conn *doozer.Conn) Backend {
+	return &doozerBackend{conn: conn}
+}
+
+func (b *doozerBackend) Get(path string) ([]byte, int64, error) {
+	var body []byte
+	var rev int64
+	var err error
+
+	body, rev, err = b.conn.Get(path, nil)
+	return body, rev, translateDoozerErr(err)
+}
+
+func (b *doozerBackend) Set(path string, oldRev int64, body []byte) (int64, error) {
+	var rev int64
+	var err error
+
+	rev, err = b.conn.Set(path, oldRev, body)
+	return rev, translateDoozerErr(err)
+}
+
+func (b *doozerBackend) Del(path string, oldRev int64) error {
+	return translateDoozerErr(b.conn.Del(path, oldRev))
+}
+
+func (b *doozerBackend) Wait(path string, sinceRev int64) (Event, error) {
+	var ev doozer.Event
+	var err error
+
+	ev, err = b.conn.Wait(path, sinceRev)
+	if err != nil {
+		return Event{}, translateDoozerErr(err)
+	}
+	return Event{
+		Path:    ev.Path,
+		Body:    ev.Body,
+		Rev:     ev.Rev,
+		Deleted: ev.IsDel(),
+	}, nil
+}
+
+func (b *doozerBackend) Rev() (int64, error) {
+	return b.conn.Rev()
+}
+
+func (b *doozerBackend) List(dir string) ([]DirEntry, error) {
+	var entries []DirEntry
+	var offset int
+
+	for {
+		var names []string
+		var err error
+
+		names, err = b.conn.Getdir(dir, 0, offset, 1)
+		if err == doozer.ErrNoEnt {
+			break
+		}
+		if err != nil {
+			return nil, translateDoozerErr(err)
+		}
+		if len(names) == 0 {
+			break
+		}
+
+		var body []byte
+		var rev int64
+
+		body, rev, err = b.conn.Get(dir+"/"+names[0], nil)
+		_ = body
+		if err != nil && err != doozer.ErrNoEnt {
+			return nil, translateDoozerErr(err)
+		}
+		entries = append(entries, DirEntry{Name: names[0], Rev: rev})
+		offset++
+	}
+	return entries, nil
+}
+
+func (b *doozerBackend) CreateCandidate(dir string, body []byte) (string, int64, error) {
+	return createCandidateByRev(b, dir, body)
+}
+
+// translateDoozerErr maps Doozer's sentinel errors onto the Backend
+// ones, so callers which only depend on the Backend interface never
+// need to import doozer themselves.
+func translateDoozerErr(err error) error {
+	switch err {
+	case doozer.ErrNoEnt:
+		return ErrNoEnt
+	case doozer.ErrOldRev:
+		return ErrOldRev
+	case doozer.ErrTooLate:
+		return ErrTooLate
+	default:
+		return err
+	}
+}
+
+// NewDoozerMasterElectionClient creates a new master election client
+// backed directly by a Doozer connection. It is kept for compatibility
+// with callers of the pre-Backend API and is equivalent to calling
+// NewMasterElectionClient with NewDoozerBackend(conn).
+func NewDoozerMasterElectionClient(conn *doozer.Conn, name string, addr net.Addr,
+	participating bool, callback MasterElectionEventReceiver) (
+	*MasterElectionClient, error) {
+	return NewMasterElectionClient(NewDoozerBackend(conn), name, addr,
+		participating, callback)
+}
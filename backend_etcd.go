@@ -0,0 +1,180 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"path"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// etcdBackend adapts an *etcd.Client to the Backend interface. etcd's
+// ModifiedIndex plays the role Doozer's revision plays elsewhere in this
+// package.
+type etcdBackend struct {
+	client *etcd.Client
+}
+
+// NewEtcdBackend wraps an existing etcd client as a Backend, for use
+// with NewMasterElectionClient.
+func NewEtcdBackend(client *etcd.Client) Backend {
+	return &etcdBackend{client: client}
+}
+
+func (b *etcdBackend) Get(path string) ([]byte, int64, error) {
+	var resp *etcd.Response
+	var err error
+
+	resp, err = b.client.Get(path, false, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return nil, 0, ErrNoEnt
+		}
+		return nil, 0, err
+	}
+	return []byte(resp.Node.Value), int64(resp.Node.ModifiedIndex), nil
+}
+
+func (b *etcdBackend) Set(path string, oldRev int64, body []byte) (int64, error) {
+	var resp *etcd.Response
+	var err error
+
+	if oldRev == 0 {
+		resp, err = b.client.Create(path, string(body), 0)
+		if isEtcdNodeExist(err) {
+			return 0, ErrOldRev
+		}
+	} else {
+		resp, err = b.client.CompareAndSwap(path, string(body), 0, "",
+			uint64(oldRev))
+	}
+	if err != nil {
+		if isEtcdTestFailed(err) {
+			return 0, ErrOldRev
+		}
+		return 0, err
+	}
+	return int64(resp.Node.ModifiedIndex), nil
+}
+
+func (b *etcdBackend) CreateCandidate(dir string, body []byte) (string, int64, error) {
+	return createCandidateByRev(b, dir, body)
+}
+
+func (b *etcdBackend) Del(path string, oldRev int64) error {
+	var _, err = b.client.CompareAndDelete(path, "", uint64(oldRev))
+	if isEtcdTestFailed(err) {
+		return ErrOldRev
+	}
+	return err
+}
+
+func (b *etcdBackend) Wait(path string, sinceRev int64) (Event, error) {
+	var resp *etcd.Response
+	var err error
+
+	resp, err = b.client.Watch(path, uint64(sinceRev), false, nil, nil)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Path:    resp.Node.Key,
+		Body:    []byte(resp.Node.Value),
+		Rev:     int64(resp.Node.ModifiedIndex),
+		Deleted: resp.Action == "delete" || resp.Action == "expire",
+	}, nil
+}
+
+func (b *etcdBackend) Rev() (int64, error) {
+	var resp *etcd.Response
+	var err error
+
+	// etcd keeps a single cluster-wide index; any response carries it,
+	// so a cheap read of the root is enough to learn the current one.
+	resp, err = b.client.Get("/", false, false)
+	if err != nil {
+		return 0, err
+	}
+	return int64(resp.EtcdIndex), nil
+}
+
+func (b *etcdBackend) List(dir string) ([]DirEntry, error) {
+	var resp *etcd.Response
+	var entries []DirEntry
+	var err error
+
+	resp, err = b.client.Get(dir, false, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, node := range resp.Node.Nodes {
+		entries = append(entries, DirEntry{
+			Name: path.Base(node.Key),
+			Rev:  int64(node.ModifiedIndex),
+		})
+	}
+	return entries, nil
+}
+
+// isEtcdKeyNotFound reports whether err is etcd's "key not found" error.
+func isEtcdKeyNotFound(err error) bool {
+	var etcdErr *etcd.EtcdError
+	var ok bool
+
+	etcdErr, ok = err.(*etcd.EtcdError)
+	return ok && etcdErr.ErrorCode == etcd.ErrCodeKeyNotFound
+}
+
+// isEtcdTestFailed reports whether err is etcd's "compare failed" error,
+// i.e. our idea of the current revision was stale.
+func isEtcdTestFailed(err error) bool {
+	var etcdErr *etcd.EtcdError
+	var ok bool
+
+	etcdErr, ok = err.(*etcd.EtcdError)
+	return ok && etcdErr.ErrorCode == etcd.ErrCodeTestFailed
+}
+
+// isEtcdNodeExist reports whether err is etcd's "node already exists"
+// error, returned by Create when path is already taken -- the create
+// equivalent of isEtcdTestFailed's stale-revision check.
+func isEtcdNodeExist(err error) bool {
+	var etcdErr *etcd.EtcdError
+	var ok bool
+
+	etcdErr, ok = err.(*etcd.EtcdError)
+	return ok && etcdErr.ErrorCode == etcd.ErrCodeNodeExist
+}
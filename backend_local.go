@@ -0,0 +1,155 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// localBackend is a trivial in-process Backend with no coordination
+// across machines: every client using it is necessarily the only
+// candidate there is. It backs NewLocalMasterElectionClient.
+type localBackend struct {
+	mu   sync.Mutex
+	rev  int64
+	body []byte
+	set  bool
+
+	// ctx is the owning client's context, so Wait can return on Resign
+	// instead of leaking the goroutine run() spawns to call it.
+	ctx context.Context
+}
+
+func newLocalBackend(ctx context.Context) *localBackend {
+	return &localBackend{ctx: ctx}
+}
+
+func (b *localBackend) Get(path string) ([]byte, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.set {
+		return nil, 0, ErrNoEnt
+	}
+	return b.body, b.rev, nil
+}
+
+func (b *localBackend) Set(path string, oldRev int64, body []byte) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rev > oldRev {
+		return 0, ErrOldRev
+	}
+	b.rev++
+	b.body = body
+	b.set = true
+	return b.rev, nil
+}
+
+func (b *localBackend) Del(path string, oldRev int64) error {
+	// There are no other candidates to hand mastership to in a local
+	// election, so deleting the master key would only cause pointless
+	// churn; ForceMasterElection is documented as a no-op success
+	// against a local client, and this is what makes it one.
+	return nil
+}
+
+func (b *localBackend) Wait(path string, sinceRev int64) (Event, error) {
+	// Nothing ever changes path behind a local client's back, so there
+	// is nothing useful to report; block until told to give up, rather
+	// than busy-loop reporting nothing. Returning on ctx.Done() avoids
+	// leaking the goroutine run() spawns to call this on every Resign.
+	<-b.ctx.Done()
+	return Event{}, b.ctx.Err()
+}
+
+func (b *localBackend) Rev() (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rev, nil
+}
+
+func (b *localBackend) List(dir string) ([]DirEntry, error) {
+	return nil, nil
+}
+
+func (b *localBackend) CreateCandidate(dir string, body []byte) (string, int64, error) {
+	return createCandidateByRev(b, dir, body)
+}
+
+// NewLocalMasterElectionClient creates a master election client backed
+// by an in-process Backend rather than a real lock server. Since it is
+// always the only candidate, it becomes master immediately -- before
+// this constructor returns, the callback's BecomeMaster has already
+// been invoked -- and ForceMasterElection against it is a no-op
+// success rather than triggering a real re-election.
+//
+// This is useful for unit tests and single-node deployments which want
+// to exercise the master codepath without standing up a Doozer, etcd,
+// Consul or ZooKeeper cluster, while keeping the exact same callback
+// contract (including proper cleanup on Resign) as the real thing.
+func NewLocalMasterElectionClient(addr net.Addr,
+	callback MasterElectionEventReceiver) (*MasterElectionClient, error) {
+	var ret = &MasterElectionClient{
+		cb:            callback,
+		participating: true,
+		own_addr:      addr,
+		path:          "/ns/service/master/local",
+	}
+	ret.ctx, ret.cancel = context.WithCancel(context.Background())
+	ret.backend = newLocalBackend(ret.ctx)
+
+	var rev, err = ret.backend.Set(ret.path, 0, ret.nextMasterBody())
+	if err != nil {
+		return nil, err
+	}
+	ret.setOldRev(rev + 1)
+
+	ret.mu.Lock()
+	ret.isMaster = true
+	ret.mu.Unlock()
+
+	err = ret.notifyBecomeMaster()
+	if err != nil {
+		return nil, err
+	}
+	if ret.LeaseDuration > 0 {
+		ret.startHeartbeat()
+	}
+
+	ret.wg.Add(1)
+	go ret.run()
+	return ret, nil
+}
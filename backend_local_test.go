@@ -0,0 +1,141 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testReceiver is a MasterElectionEventReceiver which records every
+// callback invocation for later assertions.
+type testReceiver struct {
+	mu           sync.Mutex
+	becomeMaster int
+	becomeSlave  []string
+}
+
+func (r *testReceiver) BecomeMaster() error {
+	r.mu.Lock()
+	r.becomeMaster++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *testReceiver) BecomeSlave(newMaster string) {
+	r.mu.Lock()
+	r.becomeSlave = append(r.becomeSlave, newMaster)
+	r.mu.Unlock()
+}
+
+func (r *testReceiver) ElectionError(err error) {}
+func (r *testReceiver) ElectionFatal(err error) {}
+
+func (r *testReceiver) becomeMasterCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.becomeMaster
+}
+
+// TestNewLocalMasterElectionClient checks that a local client becomes
+// master immediately, and that ForceMasterElection against it is the
+// documented no-op success rather than triggering a real re-election.
+func TestNewLocalMasterElectionClient(t *testing.T) {
+	var recv = &testReceiver{}
+	var addr = &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4242}
+
+	var m, err = NewLocalMasterElectionClient(addr, recv)
+	if err != nil {
+		t.Fatalf("NewLocalMasterElectionClient: %v", err)
+	}
+
+	if got := recv.becomeMasterCount(); got != 1 {
+		t.Fatalf("BecomeMaster called %d times, want 1", got)
+	}
+
+	if err = m.ForceMasterElection(); err != nil {
+		t.Fatalf("ForceMasterElection: %v", err)
+	}
+	if got := recv.becomeMasterCount(); got != 1 {
+		t.Fatalf("BecomeMaster called %d times after ForceMasterElection, want still 1", got)
+	}
+
+	m.mu.Lock()
+	var stillMaster = m.isMaster
+	m.mu.Unlock()
+	if !stillMaster {
+		t.Fatal("ForceMasterElection cleared isMaster against a local client")
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = m.Resign(ctx); err != nil {
+		t.Fatalf("Resign: %v", err)
+	}
+}
+
+// TestLocalMasterElectionClientResignCleanup checks that Resign fully
+// relinquishes mastership: a subsequent Proclaim must fail, and
+// Observe subscribers must see the step-down as a Deposed event.
+func TestLocalMasterElectionClientResignCleanup(t *testing.T) {
+	var recv = &testReceiver{}
+	var addr = &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4242}
+
+	var m, err = NewLocalMasterElectionClient(addr, recv)
+	if err != nil {
+		t.Fatalf("NewLocalMasterElectionClient: %v", err)
+	}
+
+	var obs = m.Observe()
+
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = m.Resign(ctx); err != nil {
+		t.Fatalf("Resign: %v", err)
+	}
+
+	if err = m.Proclaim(addr); err != ErrNotLeader {
+		t.Fatalf("Proclaim after Resign: got %v, want ErrNotLeader", err)
+	}
+
+	select {
+	case ev := <-obs:
+		if ev.Kind != Deposed {
+			t.Fatalf("first event after Resign: got kind %v, want Deposed", ev.Kind)
+		}
+	default:
+		t.Fatal("Resign did not publish a Deposed event")
+	}
+}
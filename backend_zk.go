@@ -0,0 +1,191 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"strings"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// zkBackend adapts a *zk.Conn to the Backend interface. ZooKeeper's
+// Stat.Version plays the role Doozer's revision plays elsewhere in this
+// package; it is scoped per-znode rather than cluster-wide, which is
+// harmless here since every caller only ever compares revisions it
+// previously read back for the same path.
+type zkBackend struct {
+	conn *zk.Conn
+}
+
+// NewZkBackend wraps an existing ZooKeeper connection as a Backend, for
+// use with NewMasterElectionClient.
+func NewZkBackend(conn *zk.Conn) Backend {
+	return &zkBackend{conn: conn}
+}
+
+func (b *zkBackend) Get(path string) ([]byte, int64, error) {
+	var data []byte
+	var stat *zk.Stat
+	var err error
+
+	data, stat, err = b.conn.Get(path)
+	if err == zk.ErrNoNode {
+		return nil, 0, ErrNoEnt
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, int64(stat.Version), nil
+}
+
+func (b *zkBackend) Set(path string, oldRev int64, body []byte) (int64, error) {
+	var stat *zk.Stat
+	var err error
+
+	if oldRev == 0 {
+		_, err = b.conn.Create(path, body, 0, zk.WorldACL(zk.PermAll))
+		if err == zk.ErrNodeExists {
+			// Someone beat us to creating it, so the caller gets
+			// ErrOldRev.
+			return 0, ErrOldRev
+		} else if err == nil {
+			return 0, nil
+		}
+	} else {
+		stat, err = b.conn.Set(path, body, int32(oldRev))
+	}
+	if err == zk.ErrBadVersion {
+		return 0, ErrOldRev
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Version), nil
+}
+
+func (b *zkBackend) Del(path string, oldRev int64) error {
+	var err = b.conn.Delete(path, int32(oldRev))
+	if err == zk.ErrBadVersion {
+		return ErrOldRev
+	}
+	return err
+}
+
+func (b *zkBackend) Wait(path string, sinceRev int64) (Event, error) {
+	var data []byte
+	var stat *zk.Stat
+	var events <-chan zk.Event
+	var ev zk.Event
+	var err error
+
+	data, stat, events, err = b.conn.GetW(path)
+	if err != nil {
+		return Event{}, err
+	}
+	if int64(stat.Version) >= sinceRev {
+		return Event{Path: path, Body: data, Rev: int64(stat.Version)}, nil
+	}
+
+	ev = <-events
+	if ev.Err != nil {
+		return Event{}, ev.Err
+	}
+	if ev.Type == zk.EventNodeDeleted {
+		return Event{Path: path, Rev: sinceRev, Deleted: true}, nil
+	}
+
+	data, stat, err = b.conn.Get(path)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Path: path, Body: data, Rev: int64(stat.Version)}, nil
+}
+
+// CreateCandidate creates a sequential znode under dir, rather than
+// deriving a name from Rev() as createCandidateByRev does for the other
+// backends: ZooKeeper has no cluster-wide revision counter, so every
+// candidate computing a name from Rev() would derive the same one
+// (Rev() always returns 0 here) and collide, and would then have to
+// probe for a free name one ErrOldRev at a time. Sequential znodes give
+// each candidate a
+// distinct, FIFO-ordered name without relying on Rev() at all.
+func (b *zkBackend) CreateCandidate(dir string, body []byte) (string, int64, error) {
+	var createdPath string
+	var stat *zk.Stat
+	var err error
+
+	createdPath, err = b.conn.Create(dir+"/", body, zk.FlagSequence,
+		zk.WorldACL(zk.PermAll))
+	if err != nil {
+		return "", 0, err
+	}
+
+	_, stat, err = b.conn.Get(createdPath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return strings.TrimPrefix(createdPath, dir+"/"), int64(stat.Version), nil
+}
+
+func (b *zkBackend) Rev() (int64, error) {
+	// ZooKeeper has no single cluster-wide revision counter; callers
+	// only ever compare revisions they read back for the same path, so
+	// starting from 0 and letting Get/Set report the real Stat.Version
+	// from then on is sufficient.
+	return 0, nil
+}
+
+func (b *zkBackend) List(dir string) ([]DirEntry, error) {
+	var names []string
+	var entries []DirEntry
+	var err error
+
+	names, _, err = b.conn.Children(dir)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		var stat *zk.Stat
+
+		_, stat, err = b.conn.Get(dir + "/" + name)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, DirEntry{Name: name, Rev: int64(stat.Version)})
+	}
+	return entries, nil
+}
@@ -0,0 +1,282 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"sort"
+	"time"
+)
+
+// candidatesDir is the directory, relative to m.path, holding the fair
+// election queue. Each participating client which wants to become
+// master owns exactly one entry in it while campaigning.
+const candidatesDir = "/candidates"
+
+const (
+	// waitForTurnMaxFailures bounds how many consecutive Get/Wait
+	// failures against our predecessor waitForTurn tolerates before
+	// giving up on this candidacy, rather than retrying a permanently
+	// broken backend forever.
+	waitForTurnMaxFailures = 10
+
+	// waitForTurnBackoff is the delay waitForTurn sleeps after the
+	// first consecutive Get/Wait failure, doubling on each further one
+	// up to waitForTurnMaxBackoff; this keeps a flapping predecessor
+	// read from turning into a busy-loop error storm.
+	waitForTurnBackoff = 100 * time.Millisecond
+
+	// waitForTurnMaxBackoff caps the backoff delay above.
+	waitForTurnMaxBackoff = 5 * time.Second
+)
+
+// candidateEntry identifies one entry in the candidates queue.
+type candidateEntry struct {
+	// name is the entry's name relative to candidatesDir.
+	name string
+
+	// rev is the revision the backend reported for the entry when it
+	// was created; retireCandidate deletes the entry at it. Queue order
+	// comes from the entry's name, not from rev.
+	rev int64
+}
+
+// createCandidate reserves our entry in the fair election queue. The
+// entry's name is chosen by the backend (see Backend.CreateCandidate)
+// so that simply sorting the queue's entries by name gives FIFO
+// creation order.
+func (m *MasterElectionClient) createCandidate() (candidateEntry, error) {
+	var name string
+	var rev int64
+	var err error
+
+	name, rev, err = m.backend.CreateCandidate(m.path+candidatesDir,
+		[]byte(m.getOwnAddr().String()))
+	if err != nil {
+		return candidateEntry{}, err
+	}
+	return candidateEntry{name: name, rev: rev}, nil
+}
+
+// lowestAndPredecessor lists the candidates queue and reports whether
+// self is currently its lowest entry. If it is not, the name of the
+// entry immediately preceding self is returned, which is the only one
+// self needs to watch: once it disappears, self is either the new
+// lowest entry or has a new, still-lower predecessor to watch instead.
+func (m *MasterElectionClient) lowestAndPredecessor(self candidateEntry) (
+	bool, string, error) {
+	var entries []DirEntry
+	var err error
+
+	entries, err = m.backend.List(m.path + candidatesDir)
+	if err != nil {
+		return false, "", err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	var predecessor string
+	for _, entry := range entries {
+		if entry.Name == self.name {
+			return predecessor == "", predecessor, nil
+		}
+		predecessor = entry.Name
+	}
+
+	// Our own entry is missing, most likely because we raced a
+	// ForceMasterElection which cleared the whole path. Report this as
+	// an error; waitForTurn then gives up this candidacy, and a new one
+	// is only started by a later runMasterElection.
+	return false, "", ErrNoEnt
+}
+
+// waitForTurn blocks, by watching at most one other candidate at a
+// time, until self becomes the lowest entry in the queue and promotes
+// itself to master.
+func (m *MasterElectionClient) waitForTurn(self candidateEntry) {
+	var failures int
+
+	for {
+		if m.ctx.Err() != nil {
+			m.mu.Lock()
+			m.campaigning = false
+			m.mu.Unlock()
+			return
+		}
+
+		var isLowest bool
+		var predecessor string
+		var err error
+
+		isLowest, predecessor, err = m.lowestAndPredecessor(self)
+		if err != nil {
+			m.retireCandidate(self)
+
+			m.mu.Lock()
+			m.campaigning = false
+			m.mu.Unlock()
+
+			m.notifyElectionError(err)
+			return
+		}
+
+		if isLowest {
+			m.promote(self)
+			return
+		}
+
+		var predPath = m.path + candidatesDir + "/" + predecessor
+		var predRev int64
+
+		_, predRev, err = m.backend.Get(predPath)
+		if err == ErrNoEnt {
+			// Already gone; re-check who is lowest right away.
+			failures = 0
+			continue
+		}
+		if err == nil {
+			_, err = m.backend.Wait(predPath, predRev+1)
+		}
+		if err == nil {
+			// Whether our predecessor was deleted or merely updated,
+			// loop around and re-evaluate our position in the queue.
+			failures = 0
+			continue
+		}
+
+		m.notifyElectionError(err)
+
+		failures++
+		if failures >= waitForTurnMaxFailures {
+			// Get/Wait against our predecessor has failed too many
+			// times in a row; abandon this candidacy rather than
+			// retrying a permanently broken backend forever.
+			m.retireCandidate(self)
+
+			m.mu.Lock()
+			m.campaigning = false
+			m.mu.Unlock()
+			return
+		}
+
+		if !m.backOff(failures) {
+			return
+		}
+	}
+}
+
+// backOff sleeps for an exponentially increasing delay derived from the
+// number of consecutive failures, capped at waitForTurnMaxBackoff, so a
+// flapping predecessor read backs off instead of busy-looping. It
+// reports false, having already cleared the campaigning flag, if ctx is
+// cancelled while waiting.
+func (m *MasterElectionClient) backOff(failures int) bool {
+	var delay = waitForTurnBackoff * time.Duration(uint(1)<<uint(failures-1))
+	if delay > waitForTurnMaxBackoff {
+		delay = waitForTurnMaxBackoff
+	}
+
+	select {
+	case <-m.ctx.Done():
+		m.mu.Lock()
+		m.campaigning = false
+		m.mu.Unlock()
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+// promote writes our address to m.path now that self is the lowest
+// entry in the candidates queue, making us the new master.
+func (m *MasterElectionClient) promote(self candidateEntry) {
+	var rev int64
+	var err error
+
+	rev, err = m.backend.Set(m.path, m.getOldRev(), m.nextMasterBody())
+	if err != nil {
+		// Someone else (e.g. a passive ForceMasterElection caller
+		// racing the same write) got there first; refresh our idea of
+		// the revision and let the regular Wait loop in run() pick up
+		// the resulting notification. We are abandoning this
+		// promotion attempt, so our queue entry must go too, or it
+		// becomes an orphan the next candidate queues up behind.
+		var _, curRev, getErr = m.backend.Get(m.path)
+		if getErr == nil {
+			m.setOldRev(curRev + 1)
+		}
+		m.retireCandidate(self)
+
+		m.mu.Lock()
+		m.campaigning = false
+		m.mu.Unlock()
+
+		m.notifyElectionError(err)
+		return
+	}
+	m.setOldRev(rev + 1)
+
+	err = m.notifyBecomeMaster()
+	if err != nil {
+		m.retireCandidate(self)
+
+		m.mu.Lock()
+		m.campaigning = false
+		m.mu.Unlock()
+
+		// We failed to become master, so we must force a new election.
+		m.ForceMasterElection()
+		return
+	}
+
+	m.mu.Lock()
+	m.isMaster = true
+	m.campaigning = false
+	m.mu.Unlock()
+
+	// We have written m.path; our queue entry has done its job and
+	// must be removed now; otherwise it is left behind as an orphan
+	// with no one watching it, and the next candidate to queue up
+	// behind it would wait on a predecessor that will never go away.
+	m.retireCandidate(self)
+
+	if m.LeaseDuration > 0 {
+		m.startHeartbeat()
+	}
+}
+
+// retireCandidate removes self's entry from the candidates queue, e.g.
+// after deciding not to take up a mastership we were just promoted to.
+func (m *MasterElectionClient) retireCandidate(self candidateEntry) {
+	m.backend.Del(m.path+candidatesDir+"/"+self.name, self.rev)
+}
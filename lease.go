@@ -0,0 +1,82 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// leaseInfo is the payload a master using LeaseDuration writes to its
+// path. Besides the advertised address, it carries a generation counter
+// and an expiry so that both participating followers (in run()) and
+// passive observers (via ReadCurrentMaster) can tell a live master from
+// one which has stopped heartbeating.
+type leaseInfo struct {
+	Addr       string    `json:"addr"`
+	Generation int64     `json:"generation"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// encodeLease serializes info for storage in the backend.
+func encodeLease(info leaseInfo) []byte {
+	var data []byte
+	var err error
+
+	data, err = json.Marshal(info)
+	if err != nil {
+		// Should never happen for this struct; fall back to at least
+		// advertising the address.
+		return []byte(info.Addr)
+	}
+	return data
+}
+
+// decodeLease parses the value stored at a master election path. Values
+// which are not lease JSON -- e.g. written by a client with no
+// LeaseDuration set -- are treated as a plain address with no expiry, so
+// that clients with and without leases enabled can interoperate.
+func decodeLease(body []byte) leaseInfo {
+	var info leaseInfo
+
+	if err := json.Unmarshal(body, &info); err != nil || info.Addr == "" {
+		return leaseInfo{Addr: string(body)}
+	}
+	return info
+}
+
+// expired reports whether the lease described by info has run out as of
+// "now". A lease with a zero ExpiresAt never expires, which is the case
+// for masters not using LeaseDuration.
+func (info leaseInfo) expired(now time.Time) bool {
+	return !info.ExpiresAt.IsZero() && now.After(info.ExpiresAt)
+}
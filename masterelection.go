@@ -29,15 +29,16 @@
  * OF THE POSSIBILITY OF SUCH DAMAGE.
  */
 
-// Master election algorithm which uses Doozer as a lock server to
-// determine whether or not a process is master.
+// Master election algorithm which uses a pluggable key/value coordination
+// service (Doozer, etcd, Consul or ZooKeeper, see Backend) as a lock
+// server to determine whether or not a process is master.
 package masterelection
 
 import (
+	"context"
 	"net"
 	"sync"
-
-	"github.com/ha/doozer"
+	"time"
 )
 
 // Interface for notifying the caller about changes in the master state.
@@ -73,34 +74,57 @@ type MasterElectionEventReceiver interface {
 // through the API and master elections may be forced, but the process will
 // not participate in master elections and thus never itself become master.
 type MasterElectionClient struct {
-	conn          *doozer.Conn
+	// LeaseDuration, if set, turns on lease-based mastership: the
+	// master re-advertises itself at least twice per LeaseDuration, and
+	// participating followers will evict a master whose lease has run
+	// out instead of waiting for an explicit ForceMasterElection. It
+	// must be set right after construction, before the first election
+	// has taken place, to take effect from the start.
+	LeaseDuration time.Duration
+
+	backend       Backend
 	participating bool
 	own_addr      net.Addr
 	old_rev       int64
+	generation    int64
+	leaseStop     chan struct{}
+	leaseExpiry   time.Time
+	isMaster      bool
+	campaigning   bool
+	mu            sync.Mutex
 	cb            MasterElectionEventReceiver
 	path          string
 	master        string
 	wg            sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	obsMu sync.Mutex
+	subs  []chan MasterEvent
 }
 
 // Create a new master election client for the elections with the given
-// "name". The host and port of the master will be set to "addr".
+// "name", talking to the given "backend" key/value coordination service.
+// The host and port of the master will be set to "addr".
 // If "participating" is set to true, the client will participate in master
 // elections, otherwise the client will just listen for changes of the
 // current master.
 //
 // All notifications of being a master or slave will be done on the
-// specified "callback".
-func NewMasterElectionClient(conn *doozer.Conn, name string, addr net.Addr,
+// specified "callback", which may be nil if the caller only wants to
+// use Observe() to be notified of master changes.
+func NewMasterElectionClient(backend Backend, name string, addr net.Addr,
 	participating bool, callback MasterElectionEventReceiver) (
 	*MasterElectionClient, error) {
 	var ret *MasterElectionClient = &MasterElectionClient{
 		cb:            callback,
-		conn:          conn,
+		backend:       backend,
 		participating: participating,
 		own_addr:      addr,
 		path:          "/ns/service/master/" + name,
 	}
+	ret.ctx, ret.cancel = context.WithCancel(context.Background())
 
 	ret.init()
 	return ret, nil
@@ -116,108 +140,379 @@ func (m *MasterElectionClient) init() {
 
 	m.wg.Add(1)
 
-	data, m.old_rev, err = m.conn.Get(m.path, nil)
-	if err == doozer.ErrNoEnt || m.old_rev == 0 {
-		m.old_rev, err = m.conn.Rev()
+	data, m.old_rev, err = m.backend.Get(m.path)
+	if err == ErrNoEnt || m.old_rev == 0 {
+		m.old_rev, err = m.backend.Rev()
 		if err != nil {
-			m.cb.ElectionFatal(err)
+			m.notifyElectionFatal(err)
 			return
 		} else if m.participating {
 			// There's no master, we'll have to find one.
 			m.runMasterElection()
 		}
 	} else if err != nil {
-		m.cb.ElectionFatal(err)
+		m.notifyElectionFatal(err)
 		return
 	} else {
 		m.old_rev += 1
-		m.master = string(data)
-		m.cb.BecomeSlave(m.master)
+		var lease = decodeLease(data)
+		m.master = lease.Addr
+		m.setLeaseExpiry(lease.ExpiresAt)
+		m.notifyBecomeSlave(m.master)
 	}
 
 	go m.run()
 }
 
+// waitResult carries the outcome of a Backend.Wait call back to run(),
+// so that it can be raced against ctx.Done() -- the Backend interface
+// itself has no way to cancel an in-flight Wait.
+type waitResult struct {
+	ev  Event
+	err error
+}
+
 func (m *MasterElectionClient) run() {
 	defer m.wg.Done()
 	for {
-		var ev doozer.Event
+		if m.ctx.Err() != nil {
+			return
+		}
+
+		var resCh = make(chan waitResult, 1)
+		go func(rev int64) {
+			var res waitResult
+			res.ev, res.err = m.backend.Wait(m.path, rev)
+			resCh <- res
+		}(m.getOldRev())
+
+		// A crashed master stops heartbeating and so produces no
+		// further events for backend.Wait to report; without a timer
+		// of our own here, an expired lease would only ever be
+		// noticed by accident, on the next unrelated event. Race the
+		// Wait against the lease's own deadline, when we are
+		// following one.
+		var timer *time.Timer
+		var timeoutCh <-chan time.Time
+		if deadline := m.getLeaseExpiry(); m.participating && !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeoutCh = timer.C
+		}
+
+		var ev Event
 		var err error
+		var timedOut bool
+
+		select {
+		case <-m.ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-timeoutCh:
+			timedOut = true
+		case res := <-resCh:
+			if timer != nil {
+				timer.Stop()
+			}
+			ev, err = res.ev, res.err
+		}
+
+		if timedOut {
+			m.evictExpiredMaster()
+			continue
+		}
 
-		ev, err = m.conn.Wait(m.path, m.old_rev)
 		if err != nil {
-			m.cb.ElectionError(err)
+			m.notifyElectionError(err)
 			continue
 		}
 
 		// Make sure our path matches exactly
 		if ev.Path != m.path {
-			m.old_rev = ev.Rev + 1
+			m.setOldRev(ev.Rev + 1)
 			continue
 		}
 
 		if ev.IsDel() && m.participating {
 			// Master election has been forced.
+			m.stopHeartbeat()
+			m.setLeaseExpiry(time.Time{})
 			m.runMasterElection()
 		} else if ev.IsSet() {
-			var master = string(ev.Body)
+			var lease = decodeLease(ev.Body)
+			var isOwn = lease.Addr == m.getOwnAddr().String()
 
-			if m.own_addr.String() != master {
+			if !isOwn {
 				// We're just receiving a master update.
-				m.master = string(ev.Body)
-				m.cb.BecomeSlave(m.master)
+				m.master = lease.Addr
+				m.notifyBecomeSlave(m.master)
+			}
+			m.setLeaseExpiry(lease.ExpiresAt)
+
+			if !isOwn && m.participating && lease.expired(time.Now()) {
+				// The master has stopped heartbeating. Evict it and
+				// race for the vacancy it leaves behind.
+				m.setOldRev(ev.Rev + 1)
+				if m.backend.Del(m.path, ev.Rev) == nil {
+					m.setLeaseExpiry(time.Time{})
+					m.runMasterElection()
+				}
+				continue
 			}
 		}
 
 		// Update our idea of the revision.
-		m.old_rev = ev.Rev + 1
+		m.setOldRev(ev.Rev + 1)
 	}
 }
 
-// Attempt to be elected as a master.
-func (m *MasterElectionClient) runMasterElection() {
-	var new_master []byte
+// getLeaseExpiry returns the expiry of the lease we last saw advertised
+// at m.path, or the zero Time if the current master is not using
+// LeaseDuration (or none is known yet).
+func (m *MasterElectionClient) getLeaseExpiry() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leaseExpiry
+}
+
+// setLeaseExpiry records the expiry of the lease we last saw advertised
+// at m.path.
+func (m *MasterElectionClient) setLeaseExpiry(expiry time.Time) {
+	m.mu.Lock()
+	m.leaseExpiry = expiry
+	m.mu.Unlock()
+}
+
+// evictExpiredMaster is called by run() when our lease deadline timer
+// fires with no intervening Wait event -- the usual sign of a crashed
+// master, which stops heartbeating and so never produces one. It
+// re-reads m.path, and if the lease stored there is indeed still
+// expired (and not our own), evicts it and campaigns for the vacancy.
+func (m *MasterElectionClient) evictExpiredMaster() {
+	var data []byte
 	var rev int64
 	var err error
 
-	rev, err = m.conn.Set(m.path, m.old_rev, []byte(m.own_addr.String()))
-	if err == nil {
-		err = m.cb.BecomeMaster()
-		if err != nil {
-			m.old_rev = rev + 1
+	data, rev, err = m.backend.Get(m.path)
+	if err == ErrNoEnt {
+		m.setLeaseExpiry(time.Time{})
+		return
+	}
+	if err != nil {
+		m.notifyElectionError(err)
+		return
+	}
 
-			// We failed to become master, so we must force a new election.
-			m.ForceMasterElection()
-			return
+	var lease = decodeLease(data)
+	m.setLeaseExpiry(lease.ExpiresAt)
+
+	if lease.Addr == m.getOwnAddr().String() || !lease.expired(time.Now()) {
+		// Either the lease was refreshed since our timer was set, or
+		// it is ours (we are mid-heartbeat); nothing to evict.
+		return
+	}
+
+	if m.backend.Del(m.path, rev) == nil {
+		m.setLeaseExpiry(time.Time{})
+		if m.participating {
+			m.runMasterElection()
 		}
+	}
+}
+
+// getOldRev returns the last revision we know m.path to be at.
+func (m *MasterElectionClient) getOldRev() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.old_rev
+}
+
+// setOldRev updates the last revision we know m.path to be at. It is
+// safe to call from the heartbeat goroutine as well as run().
+func (m *MasterElectionClient) setOldRev(rev int64) {
+	m.mu.Lock()
+	m.old_rev = rev
+	m.mu.Unlock()
+}
+
+// getOwnAddr returns the address we currently advertise ourselves as
+// master with. It is guarded by mu since Proclaim may change it while
+// we are master.
+func (m *MasterElectionClient) getOwnAddr() net.Addr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.own_addr
+}
+
+// Attempt to be elected as a master. Rather than racing every other
+// participating client on an immediate Set of m.path (which, under a
+// forced election, turns into a thundering herd of ErrOldRev retries),
+// this enters the fair FIFO candidate queue implemented in
+// candidate.go and waits its turn. It is a no-op if we are already
+// campaigning.
+func (m *MasterElectionClient) runMasterElection() {
+	var self candidateEntry
+	var err error
 
-		// We are now a new master!
-		m.old_rev = rev + 1
+	m.mu.Lock()
+	if m.campaigning {
+		m.mu.Unlock()
 		return
-	} else if err != doozer.ErrTooLate && err != doozer.ErrOldRev {
-		m.cb.ElectionError(err)
 	}
+	m.campaigning = true
+	m.mu.Unlock()
 
-	// Let's do a read-current.
-	new_master, rev, err = m.conn.Get(m.path, nil)
+	self, err = m.createCandidate()
 	if err != nil {
-		m.cb.ElectionError(err)
+		m.mu.Lock()
+		m.campaigning = false
+		m.mu.Unlock()
+
+		m.notifyElectionError(err)
 		return
 	}
-	m.old_rev = rev + 1
-	m.master = string(new_master)
-	m.cb.BecomeSlave(m.master)
+
+	go m.waitForTurn(self)
 }
 
 // Force a master election to take place right now.
 func (m *MasterElectionClient) ForceMasterElection() error {
-	var err error = m.conn.Del(m.path, m.old_rev)
-	if err != nil && err != doozer.ErrTooLate && err != doozer.ErrOldRev {
-		m.cb.ElectionError(err)
+	var err error = m.backend.Del(m.path, m.getOldRev())
+	if err != nil && err != ErrTooLate && err != ErrOldRev {
+		m.notifyElectionError(err)
+	}
+	return err
+}
+
+// notifyBecomeMaster invokes the callback's BecomeMaster (if a callback
+// was given) and publishes an Elected event to any Observe subscribers.
+func (m *MasterElectionClient) notifyBecomeMaster() error {
+	var err error
+
+	if m.cb != nil {
+		err = m.cb.BecomeMaster()
 	}
+	m.publish(MasterEvent{Kind: Elected})
 	return err
 }
 
+// notifyBecomeSlave invokes the callback's BecomeSlave (if a callback
+// was given) and publishes the corresponding Observe events: a Deposed
+// event if we were master until now, followed by a MasterChanged event
+// carrying the new address.
+func (m *MasterElectionClient) notifyBecomeSlave(addr string) {
+	m.mu.Lock()
+	var wasMaster = m.isMaster
+	m.isMaster = false
+	m.mu.Unlock()
+
+	if wasMaster {
+		m.publish(MasterEvent{Kind: Deposed})
+	}
+
+	if m.cb != nil {
+		m.cb.BecomeSlave(addr)
+	}
+	m.publish(MasterEvent{Kind: MasterChanged, Addr: addr})
+}
+
+// notifyElectionError invokes the callback's ElectionError (if a
+// callback was given) and publishes a non-fatal Error event.
+func (m *MasterElectionClient) notifyElectionError(err error) {
+	if m.cb != nil {
+		m.cb.ElectionError(err)
+	}
+	m.publish(MasterEvent{Kind: Error, Err: err})
+}
+
+// notifyElectionFatal invokes the callback's ElectionFatal (if a
+// callback was given) and publishes a fatal Error event.
+func (m *MasterElectionClient) notifyElectionFatal(err error) {
+	if m.cb != nil {
+		m.cb.ElectionFatal(err)
+	}
+	m.publish(MasterEvent{Kind: Error, Err: err, Fatal: true})
+}
+
+// nextMasterBody returns the value to advertise ourselves as master
+// with, bumping the lease generation counter if LeaseDuration is in
+// use.
+func (m *MasterElectionClient) nextMasterBody() []byte {
+	return m.bodyForAddr(m.getOwnAddr())
+}
+
+// bodyForAddr is like nextMasterBody, but advertises addr instead of
+// whatever m.own_addr currently is; Proclaim uses this to change our
+// advertised address without a full BecomeMaster/BecomeSlave cycle.
+func (m *MasterElectionClient) bodyForAddr(addr net.Addr) []byte {
+	if m.LeaseDuration <= 0 {
+		return []byte(addr.String())
+	}
+
+	m.mu.Lock()
+	m.generation++
+	var generation = m.generation
+	m.mu.Unlock()
+
+	return encodeLease(leaseInfo{
+		Addr:       addr.String(),
+		Generation: generation,
+		ExpiresAt:  time.Now().Add(m.LeaseDuration),
+	})
+}
+
+// startHeartbeat launches the goroutine which periodically re-Sets
+// m.path so our lease does not expire while we are master. Any
+// previously running heartbeat is stopped first.
+func (m *MasterElectionClient) startHeartbeat() {
+	m.stopHeartbeat()
+
+	var stop = make(chan struct{})
+	m.mu.Lock()
+	m.leaseStop = stop
+	m.mu.Unlock()
+
+	go m.heartbeat(stop)
+}
+
+// stopHeartbeat stops a previously started heartbeat goroutine, if any.
+func (m *MasterElectionClient) stopHeartbeat() {
+	m.mu.Lock()
+	var stop = m.leaseStop
+	m.leaseStop = nil
+	m.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+}
+
+// heartbeat periodically re-advertises us as master with a fresh lease,
+// twice per LeaseDuration, until told to stop or until it loses the
+// race to do so (at which point some other node has taken over, or our
+// connection to the backend is stale, and run() will notice on its
+// own).
+func (m *MasterElectionClient) heartbeat(stop chan struct{}) {
+	var ticker = time.NewTicker(m.LeaseDuration / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			var rev, err = m.backend.Set(m.path, m.getOldRev(), m.nextMasterBody())
+			if err != nil {
+				// We've lost the lease; let run() discover the new
+				// master from the resulting Wait event.
+				return
+			}
+			m.setOldRev(rev + 1)
+		}
+	}
+}
+
 // Get what we think is currently the master. This is a very cheap
 // operation which only reads local state.
 //
@@ -238,8 +533,11 @@ func (m *MasterElectionClient) ReadCurrentMaster() (string, error) {
 	var data []byte
 	var err error
 
-	data, _, err = m.conn.Get(m.path, nil)
-	return string(data), err
+	data, _, err = m.backend.Get(m.path)
+	if err != nil {
+		return "", err
+	}
+	return decodeLease(data).Addr, nil
 }
 
 // Wait synchronously for the master election to exit (basically never).
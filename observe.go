@@ -0,0 +1,121 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+// MasterEventKind distinguishes the different kinds of MasterEvent
+// delivered on the channel returned by Observe.
+type MasterEventKind int
+
+const (
+	// Elected is sent when this client has just become master.
+	Elected MasterEventKind = iota
+
+	// Deposed is sent when this client has just stopped being master,
+	// whether voluntarily (Resign) or because another node took over.
+	Deposed
+
+	// MasterChanged is sent every time another node is reported as
+	// master, alongside the BecomeSlave callback, including the first
+	// time it becomes known and when that node merely re-advertises the
+	// same address. It is not sent when this client itself becomes
+	// master or changes its address via Proclaim. The master's address
+	// is carried in MasterEvent.Addr.
+	MasterChanged
+
+	// Error is sent for both non-fatal and fatal errors encountered
+	// during the election process; see MasterEvent.Fatal.
+	Error
+)
+
+// MasterEvent is delivered on the channel returned by Observe, as a
+// channel-based alternative to implementing MasterElectionEventReceiver.
+type MasterEvent struct {
+	// Kind says which of the constants above this event represents.
+	Kind MasterEventKind
+
+	// Addr holds the new master address for a MasterChanged event.
+	Addr string
+
+	// Err holds the error for an Error event.
+	Err error
+
+	// Fatal says whether an Error event corresponds to
+	// ElectionFatal rather than ElectionError.
+	Fatal bool
+}
+
+// observeBufferSize is the amount of buffering given to each channel
+// returned by Observe, so that bursts of events do not immediately
+// force the drop-oldest policy below to kick in.
+const observeBufferSize = 16
+
+// Observe returns a channel of MasterEvent values describing this
+// client's view of the election, as an alternative to implementing
+// MasterElectionEventReceiver. It may be called any number of times;
+// each call returns an independent channel. The channel is never
+// closed.
+//
+// A slow consumer does not block the election loop: if a subscriber's
+// channel is full when an event is published, its oldest buffered
+// event is dropped to make room for the new one.
+func (m *MasterElectionClient) Observe() <-chan MasterEvent {
+	var ch = make(chan MasterEvent, observeBufferSize)
+
+	m.obsMu.Lock()
+	m.subs = append(m.subs, ch)
+	m.obsMu.Unlock()
+
+	return ch
+}
+
+// publish fans ev out to every channel subscriber registered via
+// Observe, applying the drop-oldest policy for subscribers which are
+// not keeping up.
+func (m *MasterElectionClient) publish(ev MasterEvent) {
+	m.obsMu.Lock()
+	defer m.obsMu.Unlock()
+
+	for _, ch := range m.subs {
+		select {
+		case ch <- ev:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+}
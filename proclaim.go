@@ -0,0 +1,85 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"errors"
+	"net"
+)
+
+// ErrNotLeader is returned by Proclaim when the client is not currently
+// the master, or loses mastership during the call.
+var ErrNotLeader = errors.New("masterelection: this client is not the current master")
+
+// Proclaim updates the address this client advertises as master to
+// newAddr, without relinquishing leadership and without observers
+// seeing a spurious BecomeSlave/BecomeMaster cycle. This is useful when
+// a master's host:port changes (e.g. after a port rebind or a TLS
+// certificate rotation) but it otherwise remains the rightful master.
+//
+// Proclaim only succeeds while this client is master. If the
+// underlying CAS fails because our lease or revision has moved on --
+// meaning some other node may already believe it is master -- Proclaim
+// returns ErrNotLeader and the caller should treat leadership as lost.
+func (m *MasterElectionClient) Proclaim(newAddr net.Addr) error {
+	m.mu.Lock()
+	if !m.isMaster {
+		m.mu.Unlock()
+		return ErrNotLeader
+	}
+	var oldAddr = m.own_addr
+	m.own_addr = newAddr
+	m.mu.Unlock()
+
+	// own_addr is updated before the Set, not after: a concurrent Wait
+	// in run() could otherwise observe the new body while getOwnAddr
+	// still returns oldAddr, conclude isOwn is false, and fire a
+	// spurious BecomeSlave/Deposed cycle for the leadership we still
+	// hold. Roll own_addr back if the Set does not go through.
+	var rev int64
+	var err error
+
+	rev, err = m.backend.Set(m.path, m.getOldRev(), m.bodyForAddr(newAddr))
+	if err != nil {
+		m.mu.Lock()
+		m.own_addr = oldAddr
+		m.mu.Unlock()
+
+		if err == ErrOldRev || err == ErrTooLate {
+			return ErrNotLeader
+		}
+		return err
+	}
+
+	m.setOldRev(rev + 1)
+	return nil
+}
@@ -0,0 +1,83 @@
+/**
+ * (c) 2014, Caoimhe Chaos <caoimhechaos@protonmail.com>,
+ *	     Ancient Solutions. All rights reserved.
+ *
+ * Redistribution and use in source  and binary forms, with or without
+ * modification, are permitted  provided that the following conditions
+ * are met:
+ *
+ * * Redistributions of  source code  must retain the  above copyright
+ *   notice, this list of conditions and the following disclaimer.
+ * * Redistributions in binary form must reproduce the above copyright
+ *   notice, this  list of conditions and the  following disclaimer in
+ *   the  documentation  and/or  other  materials  provided  with  the
+ *   distribution.
+ * * Neither  the  name  of  Ancient Solutions  nor  the  name  of its
+ *   contributors may  be used to endorse or  promote products derived
+ *   from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS"  AND ANY EXPRESS  OR IMPLIED WARRANTIES  OF MERCHANTABILITY
+ * AND FITNESS  FOR A PARTICULAR  PURPOSE ARE DISCLAIMED. IN  NO EVENT
+ * SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL,  EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED  TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE,  DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT  LIABILITY,  OR  TORT  (INCLUDING NEGLIGENCE  OR  OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+ * OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package masterelection
+
+import (
+	"context"
+)
+
+// Resign stops this client's participation in the master election.
+//
+// If we are currently master, our mastership is relinquished
+// immediately by a CAS-Del of m.path (rather than simply letting a
+// lease expire, which could take up to LeaseDuration), so a successor
+// is elected right away. If we are only a follower, or a non-
+// participating observer, Resign just stops the watch goroutine.
+//
+// Resign blocks until shutdown has completed or ctx is done, whichever
+// comes first; once it returns nil, SyncWait also returns. Resign may
+// be called at most once.
+func (m *MasterElectionClient) Resign(ctx context.Context) error {
+	m.mu.Lock()
+	var wasMaster = m.isMaster
+	m.mu.Unlock()
+
+	if wasMaster {
+		m.stopHeartbeat()
+
+		var err = m.backend.Del(m.path, m.getOldRev())
+		if err != nil && err != ErrOldRev && err != ErrTooLate {
+			return err
+		}
+
+		m.mu.Lock()
+		m.isMaster = false
+		m.mu.Unlock()
+
+		m.publish(MasterEvent{Kind: Deposed})
+	}
+
+	m.cancel()
+
+	var done = make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}